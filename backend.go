@@ -0,0 +1,178 @@
+package sqlm
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+)
+
+// Backend abstracts the SQL driver a QHooks instance instruments, so the same
+// hooks/metrics/tracing machinery can sit in front of MySQL, PostgreSQL, or
+// SQLite rather than being wired directly to mysql.Config.
+type Backend interface {
+	// Driver returns the underlying database/sql/driver.Driver to wrap with hooks.
+	Driver() driver.Driver
+	// DSN returns the data source name sql.Open should use to reach this backend.
+	DSN() string
+	// Name returns the driver name RegisterDriver should register this backend under.
+	Name() string
+	// HostInfo returns the host (and, where applicable, port) this backend connects to.
+	HostInfo() string
+	// DBInfo returns the database name this backend connects to.
+	DBInfo() string
+	// UserInfo returns the user this backend authenticates as.
+	UserInfo() string
+	// DBSystem returns the OpenTelemetry semantic-convention db.system value
+	// for this backend, e.g. "mysql" or "postgresql".
+	DBSystem() string
+}
+
+// MySQLBackend adapts a *mysql.Config into a Backend.
+type MySQLBackend struct {
+	cfg *mysql.Config
+}
+
+func NewMySQLBackend(cfg *mysql.Config) *MySQLBackend {
+	return &MySQLBackend{cfg: cfg}
+}
+
+func (b *MySQLBackend) Driver() driver.Driver {
+	return &mysql.MySQLDriver{}
+}
+
+func (b *MySQLBackend) DSN() string {
+	return b.cfg.FormatDSN() + fmt.Sprintf("&parseTime=True&loc=%s&time_zone=%s", time.Local.String(), url.QueryEscape("'+00:00'"))
+}
+
+func (b *MySQLBackend) Name() string {
+	return "mysqlm"
+}
+
+func (b *MySQLBackend) HostInfo() string {
+	return b.cfg.Addr
+}
+
+func (b *MySQLBackend) DBInfo() string {
+	return b.cfg.DBName
+}
+
+func (b *MySQLBackend) UserInfo() string {
+	return b.cfg.User
+}
+
+func (b *MySQLBackend) DBSystem() string {
+	return "mysql"
+}
+
+// PostgresConfig holds the connection parameters for a PostgresBackend.
+type PostgresConfig struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	DBName   string
+	SSLMode  string
+}
+
+// PostgresBackend adapts a *PostgresConfig into a Backend backed by lib/pq.
+type PostgresBackend struct {
+	cfg *PostgresConfig
+}
+
+func NewPostgresBackend(cfg *PostgresConfig) *PostgresBackend {
+	return &PostgresBackend{cfg: cfg}
+}
+
+func (b *PostgresBackend) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+func (b *PostgresBackend) DSN() string {
+	sslMode := b.cfg.SSLMode
+	if sslMode == `` {
+		sslMode = "disable"
+	}
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		pqQuote(b.cfg.Host), b.cfg.Port, pqQuote(b.cfg.User), pqQuote(b.cfg.Password), pqQuote(b.cfg.DBName), pqQuote(sslMode))
+}
+
+// pqQuote single-quotes v for use as a keyword/value connection-string value
+// (libpq's "key=value" DSN format), escaping backslashes and single quotes as
+// the format requires. Needed because b.cfg's fields are arbitrary strings
+// that may contain spaces or quotes, unlike mysql.Config.FormatDSN() above,
+// which handles this for MySQLBackend already.
+func pqQuote(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return `'` + v + `'`
+}
+
+func (b *PostgresBackend) Name() string {
+	return "postgresm"
+}
+
+func (b *PostgresBackend) HostInfo() string {
+	return fmt.Sprintf("%s:%d", b.cfg.Host, b.cfg.Port)
+}
+
+func (b *PostgresBackend) DBInfo() string {
+	return b.cfg.DBName
+}
+
+func (b *PostgresBackend) UserInfo() string {
+	return b.cfg.User
+}
+
+func (b *PostgresBackend) DBSystem() string {
+	return "postgresql"
+}
+
+// SQLiteConfig holds the connection parameters for a SQLiteBackend.
+type SQLiteConfig struct {
+	// Path is the database file path, or ":memory:" for an in-memory database.
+	Path string
+}
+
+// SQLiteBackend adapts a *SQLiteConfig into a Backend backed by modernc.org/sqlite,
+// a CGo-free SQLite driver.
+type SQLiteBackend struct {
+	cfg *SQLiteConfig
+}
+
+func NewSQLiteBackend(cfg *SQLiteConfig) *SQLiteBackend {
+	return &SQLiteBackend{cfg: cfg}
+}
+
+func (b *SQLiteBackend) Driver() driver.Driver {
+	return &sqlite.Driver{}
+}
+
+func (b *SQLiteBackend) DSN() string {
+	return b.cfg.Path
+}
+
+func (b *SQLiteBackend) Name() string {
+	return "sqlitem"
+}
+
+func (b *SQLiteBackend) HostInfo() string {
+	return ``
+}
+
+func (b *SQLiteBackend) DBInfo() string {
+	return b.cfg.Path
+}
+
+func (b *SQLiteBackend) UserInfo() string {
+	return ``
+}
+
+func (b *SQLiteBackend) DBSystem() string {
+	return "sqlite"
+}
@@ -0,0 +1,73 @@
+package sqlm
+
+import "testing"
+
+func TestPostgresBackendDSN(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  *PostgresConfig
+		want string
+	}{
+		{
+			name: "plain values",
+			cfg: &PostgresConfig{
+				Host: "localhost", Port: 5432, User: "app", Password: "secret", DBName: "app_db",
+			},
+			want: `host='localhost' port=5432 user='app' password='secret' dbname='app_db' sslmode='disable'`,
+		},
+		{
+			name: "sslmode is passed through unquoted-safe",
+			cfg: &PostgresConfig{
+				Host: "localhost", Port: 5432, User: "app", Password: "secret", DBName: "app_db", SSLMode: "require",
+			},
+			want: `host='localhost' port=5432 user='app' password='secret' dbname='app_db' sslmode='require'`,
+		},
+		{
+			name: "password with a space",
+			cfg: &PostgresConfig{
+				Host: "localhost", Port: 5432, User: "app", Password: "pass with spaces", DBName: "app_db",
+			},
+			want: `host='localhost' port=5432 user='app' password='pass with spaces' dbname='app_db' sslmode='disable'`,
+		},
+		{
+			name: "password with a quote and a backslash",
+			cfg: &PostgresConfig{
+				Host: "localhost", Port: 5432, User: "app", Password: `o'brien\`, DBName: "app_db",
+			},
+			want: `host='localhost' port=5432 user='app' password='o\'brien\\' dbname='app_db' sslmode='disable'`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := NewPostgresBackend(tc.cfg).DSN()
+			if got != tc.want {
+				t.Errorf("DSN() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPqQuote(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "empty", value: ``, want: `''`},
+		{name: "plain", value: `app_db`, want: `'app_db'`},
+		{name: "space", value: `pass with spaces`, want: `'pass with spaces'`},
+		{name: "single quote", value: `o'brien`, want: `'o\'brien'`},
+		{name: "backslash", value: `back\slash`, want: `'back\\slash'`},
+		{name: "quote and backslash", value: `\'`, want: `'\\\''`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := pqQuote(tc.value)
+			if got != tc.want {
+				t.Errorf("pqQuote(%q) = %q, want %q", tc.value, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package sqlm
+
+import (
+	"strings"
+	"unicode"
+)
+
+// tokenKind classifies a lexical token produced by tokenize.
+type tokenKind int
+
+const (
+	tokSpace tokenKind = iota
+	tokIdent
+	tokLiteral
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// opKeywords are the first-token keywords Normalize reports as the query's
+// operation kind.
+var opKeywords = map[string]bool{
+	"SELECT": true, "INSERT": true, "UPDATE": true, "DELETE": true,
+	"REPLACE": true, "MERGE": true, "CREATE": true, "DROP": true,
+	"ALTER": true, "TRUNCATE": true, "BEGIN": true, "COMMIT": true,
+	"ROLLBACK": true, "SET": true, "SHOW": true, "EXPLAIN": true,
+}
+
+// Normalize tokenizes query and returns its operation kind (the first
+// significant keyword after stripping comments and, for CTEs, the WITH
+// clause) alongside a canonical form of the query with all literals and
+// IN (...) lists collapsed to a single "?", and repeated VALUES tuples
+// collapsed to one. Metric labels and span names should both be derived
+// from a single Normalize call so they never disagree on what a query is.
+func Normalize(query string) (op string, canonical string) {
+	toks := tokenize(query)
+	return detectOp(toks), canonicalize(toks)
+}
+
+// tokenize turns query into a stream of tokens, stripping `--` and `/* */`
+// comments, collapsing string/number literals and `?` placeholders into a
+// single literal token each, and preserving identifier/keyword casing.
+func tokenize(query string) []token {
+	r := []rune(query)
+	n := len(r)
+	toks := make([]token, 0, n/4+1)
+
+	for i := 0; i < n; {
+		c := r[i]
+		switch {
+		case c == '-' && i+1 < n && r[i+1] == '-':
+			i += 2
+			for i < n && r[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < n && r[i+1] == '*':
+			i += 2
+			for i+1 < n && !(r[i] == '*' && r[i+1] == '/') {
+				i++
+			}
+			i += 2
+			if i > n {
+				i = n
+			}
+		case unicode.IsSpace(c):
+			j := i
+			for j < n && unicode.IsSpace(r[j]) {
+				j++
+			}
+			toks = append(toks, token{kind: tokSpace, text: " "})
+			i = j
+		case c == '\'' || c == '"':
+			i = skipQuoted(r, i, c)
+			toks = append(toks, token{kind: tokLiteral, text: "?"})
+		case c == '`':
+			j := i + 1
+			for j < n && r[j] != '`' {
+				j++
+			}
+			j++
+			if j > n {
+				j = n
+			}
+			toks = append(toks, token{kind: tokIdent, text: string(r[i:j])})
+			i = j
+		case c == '?':
+			toks = append(toks, token{kind: tokLiteral, text: "?"})
+			i++
+		case unicode.IsDigit(c):
+			j := i
+			for j < n && (unicode.IsDigit(r[j]) || r[j] == '.' || r[j] == 'e' || r[j] == 'E' ||
+				((r[j] >= 'a' && r[j] <= 'f') || (r[j] >= 'A' && r[j] <= 'F') || r[j] == 'x' || r[j] == 'X')) {
+				j++
+			}
+			toks = append(toks, token{kind: tokLiteral, text: "?"})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < n && (unicode.IsLetter(r[j]) || unicode.IsDigit(r[j]) || r[j] == '_') {
+				j++
+			}
+			toks = append(toks, token{kind: tokIdent, text: string(r[i:j])})
+			i = j
+		default:
+			if i+1 < n {
+				switch string(r[i : i+2]) {
+				case "<=", ">=", "<>", "!=", "::":
+					toks = append(toks, token{kind: tokPunct, text: string(r[i : i+2])})
+					i += 2
+					continue
+				}
+			}
+			toks = append(toks, token{kind: tokPunct, text: string(c)})
+			i++
+		}
+	}
+	return toks
+}
+
+// skipQuoted returns the index just past the closing quote character, given
+// i points at the opening quote. It understands doubled-quote (” or "")
+// escaping and backslash escaping.
+func skipQuoted(r []rune, i int, quote rune) int {
+	n := len(r)
+	j := i + 1
+	for j < n {
+		if r[j] == '\\' && j+1 < n {
+			j += 2
+			continue
+		}
+		if r[j] == quote {
+			if j+1 < n && r[j+1] == quote {
+				j += 2
+				continue
+			}
+			return j + 1
+		}
+		j++
+	}
+	return n
+}
+
+// detectOp returns the operation kind for a token stream: the first
+// significant keyword, or, for a leading WITH, the first top-level (not
+// inside a CTE body's parens) keyword from opKeywords that follows it.
+func detectOp(toks []token) string {
+	first := -1
+	for i, t := range toks {
+		if t.kind != tokSpace {
+			first = i
+			break
+		}
+	}
+	if first == -1 {
+		return "OTHER"
+	}
+
+	head := strings.ToUpper(toks[first].text)
+	if head != "WITH" {
+		if opKeywords[head] {
+			return head
+		}
+		return "OTHER"
+	}
+
+	depth := 0
+	for _, t := range toks[first+1:] {
+		switch {
+		case t.kind == tokPunct && t.text == "(":
+			depth++
+		case t.kind == tokPunct && t.text == ")":
+			depth--
+		case depth == 0 && t.kind == tokIdent:
+			if up := strings.ToUpper(t.text); opKeywords[up] {
+				return up
+			}
+		}
+	}
+	return "WITH"
+}
+
+// canonicalize renders toks back into a query string with every literal
+// collapsed to "?", IN (...) lists collapsed to a single "?", and repeated
+// parenthesized tuples (e.g. multi-row VALUES) collapsed to the first one.
+func canonicalize(toks []token) string {
+	plain := make([]string, 0, len(toks))
+	for _, t := range toks {
+		if t.kind == tokSpace {
+			continue
+		}
+		plain = append(plain, t.text)
+	}
+
+	plain = collapseInLists(plain)
+	plain = collapseRepeatedTuples(plain)
+
+	return render(plain)
+}
+
+// matchingParen returns the index of the ")" matching the "(" at open, or -1.
+func matchingParen(toks []string, open int) int {
+	depth := 0
+	for i := open; i < len(toks); i++ {
+		switch toks[i] {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// collapseInLists rewrites `IN (?, ?, ?)` to `IN (?)` so list length doesn't
+// affect metric cardinality.
+func collapseInLists(toks []string) []string {
+	out := make([]string, 0, len(toks))
+	for i := 0; i < len(toks); i++ {
+		if strings.ToUpper(toks[i]) == "IN" && i+1 < len(toks) && toks[i+1] == "(" {
+			if closeIdx := matchingParen(toks, i+1); closeIdx != -1 {
+				onlyPlaceholders := closeIdx > i+2
+				for _, t := range toks[i+2 : closeIdx] {
+					if t != "?" && t != "," {
+						onlyPlaceholders = false
+						break
+					}
+				}
+				if onlyPlaceholders {
+					out = append(out, toks[i], "(", "?", ")")
+					i = closeIdx
+					continue
+				}
+			}
+		}
+		out = append(out, toks[i])
+	}
+	return out
+}
+
+// collapseRepeatedTuples rewrites runs of identical comma-separated
+// parenthesized groups, e.g. `(?,?),(?,?),(?,?)` from a multi-row INSERT,
+// down to the first occurrence.
+func collapseRepeatedTuples(toks []string) []string {
+	out := make([]string, 0, len(toks))
+	for i := 0; i < len(toks); i++ {
+		if toks[i] != "(" {
+			out = append(out, toks[i])
+			continue
+		}
+		closeIdx := matchingParen(toks, i)
+		if closeIdx == -1 {
+			out = append(out, toks[i:]...)
+			break
+		}
+
+		group := strings.Join(toks[i:closeIdx+1], "")
+		last := closeIdx
+		for last+2 < len(toks) && toks[last+1] == "," && toks[last+2] == "(" {
+			nextClose := matchingParen(toks, last+2)
+			if nextClose == -1 || strings.Join(toks[last+2:nextClose+1], "") != group {
+				break
+			}
+			last = nextClose
+		}
+
+		out = append(out, toks[i:closeIdx+1]...)
+		i = last
+	}
+	return out
+}
+
+// render joins tokens into a string with SQL-appropriate spacing.
+func render(toks []string) string {
+	var b strings.Builder
+	for i, t := range toks {
+		if i > 0 {
+			prev := toks[i-1]
+			if t != "," && t != ")" && t != ";" && t != "." && prev != "(" && prev != "." {
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString(t)
+	}
+	return b.String()
+}
@@ -0,0 +1,107 @@
+package sqlm
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		name      string
+		query     string
+		wantOp    string
+		wantQuery string
+	}{
+		{
+			name:      "select literal",
+			query:     "SELECT * FROM users WHERE id = 1",
+			wantOp:    "SELECT",
+			wantQuery: "SELECT * FROM users WHERE id = ?",
+		},
+		{
+			name:      "multi-row insert",
+			query:     "INSERT INTO t (a,b) VALUES (1,2),(3,4),(5,6)",
+			wantOp:    "INSERT",
+			wantQuery: "INSERT INTO t (a, b) VALUES (?, ?)",
+		},
+		{
+			name:      "upsert",
+			query:     "INSERT INTO t VALUES (1,2) ON DUPLICATE KEY UPDATE a=2",
+			wantOp:    "INSERT",
+			wantQuery: "INSERT INTO t VALUES (?, ?) ON DUPLICATE KEY UPDATE a = ?",
+		},
+		{
+			name:      "in list collapses regardless of length",
+			query:     "SELECT * FROM t WHERE id IN (1,2,3,4,5)",
+			wantOp:    "SELECT",
+			wantQuery: "SELECT * FROM t WHERE id IN (?)",
+		},
+		{
+			name:      "cte finds the real operation",
+			query:     "WITH cte AS (SELECT 1) SELECT * FROM cte WHERE x = 1",
+			wantOp:    "SELECT",
+			wantQuery: "WITH cte AS (SELECT ?) SELECT * FROM cte WHERE x = ?",
+		},
+		{
+			name:      "line comment is stripped",
+			query:     "-- note\nSELECT 1",
+			wantOp:    "SELECT",
+			wantQuery: "SELECT ?",
+		},
+		{
+			name:      "block comment is stripped",
+			query:     "/* note */ UPDATE t SET a=1 WHERE b='c'",
+			wantOp:    "UPDATE",
+			wantQuery: "UPDATE t SET a = ? WHERE b = ?",
+		},
+		{
+			name:      "quoted literals and quoted identifiers",
+			query:     "SELECT * FROM `order` WHERE \"weird\" = 'yo'",
+			wantOp:    "SELECT",
+			wantQuery: "SELECT * FROM `order` WHERE ? = ?",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			op, canonical := Normalize(tc.query)
+			if op != tc.wantOp {
+				t.Errorf("op = %q, want %q", op, tc.wantOp)
+			}
+			if canonical != tc.wantQuery {
+				t.Errorf("canonical = %q, want %q", canonical, tc.wantQuery)
+			}
+		})
+	}
+}
+
+// FuzzNormalize checks that Normalize never panics, and that it's idempotent
+// on its own output -- re-normalizing an already-canonical query must not
+// change it, since metric labels get fed back through SanitizeQuery.
+func FuzzNormalize(f *testing.F) {
+	seeds := []string{
+		"SELECT * FROM users WHERE id = 1",
+		"INSERT INTO t (a,b) VALUES (1,2),(3,4),(5,6)",
+		"INSERT INTO t VALUES (1,2) ON DUPLICATE KEY UPDATE a=2",
+		"WITH cte AS (SELECT 1) SELECT * FROM cte WHERE x = 1",
+		"SELECT * FROM t WHERE id IN (1,2,3,4,5)",
+		"-- comment\nSELECT 1",
+		"/* block */ UPDATE t SET a=1 WHERE b='c'",
+		"SELECT * FROM `order` WHERE \"weird\" = 'yo'",
+		"",
+		"(((",
+		"'unterminated",
+	}
+	for _, s := range seeds {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, query string) {
+		op, canonical := Normalize(query)
+		if op == "" {
+			t.Fatalf("Normalize(%q) returned empty op", query)
+		}
+
+		_, canonicalAgain := Normalize(canonical)
+		if canonicalAgain != canonical {
+			t.Fatalf("Normalize not idempotent: Normalize(%q) = %q, Normalize(that) = %q", query, canonical, canonicalAgain)
+		}
+	})
+}
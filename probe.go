@@ -0,0 +1,279 @@
+package sqlm
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/qustavo/sqlhooks/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ProbeQuery is a single health/introspection query ProbeHandler runs against
+// a probed target. Any rows it returns are discarded; only whether it errored
+// and how long it took are reported.
+type ProbeQuery struct {
+	// Name labels the probe_query_* metrics this query produces.
+	Name string
+	// SQL is the query text to run, e.g. "SELECT 1" or "SHOW SLAVE STATUS".
+	SQL string
+}
+
+// ProbeConfig controls ProbeHandler.
+type ProbeConfig struct {
+	// Backend builds the Backend to probe a target with, given the "target"
+	// query parameter verbatim. It's called at most once per target between
+	// pool evictions.
+	Backend func(target string) (Backend, error)
+	// Queries are the health/introspection queries run against every probed
+	// target, in order.
+	Queries []ProbeQuery
+	// Timeout bounds how long a single probe (all Queries) may take.
+	// Defaults to defaultProbeTimeout.
+	Timeout time.Duration
+	// PoolSize caps the number of *sql.DB handles ProbeHandler keeps open
+	// across requests, evicting the least recently used target once
+	// exceeded. Defaults to defaultProbePoolSize.
+	PoolSize int
+	// IdleTimeout is how long a pooled *sql.DB may go unused and still be
+	// reused; a target probed again after longer than this gets its old
+	// *sql.DB closed and a new one opened. Idle handles are not closed in the
+	// background: one stays open until its target is probed again or it is
+	// evicted as least recently used. Defaults to defaultProbeIdleTimeout.
+	IdleTimeout time.Duration
+	// Monitor, when set, additionally wraps each probed backend's driver
+	// with QHooks bound to Monitor, so probe queries also count toward its
+	// query_total/query_latency/etc. series (e.g. sqlm.Default()), on top
+	// of the probe_* metrics each scrape already reports. Leave nil to
+	// probe with unwrapped drivers, as before.
+	Monitor *QMonitor
+	// TracerProvider, used to create the tracer QHooks starts spans with
+	// when Monitor is set, instead of the global OpenTelemetry tracer
+	// provider. Ignored when Monitor is nil.
+	TracerProvider trace.TracerProvider
+}
+
+const (
+	defaultProbeTimeout     = 10 * time.Second
+	defaultProbePoolSize    = 16
+	defaultProbeIdleTimeout = 5 * time.Minute
+)
+
+// ProbeHandler returns an http.Handler in the style of postgres_exporter's
+// /probe endpoint: given a "target" query parameter, it opens (or reuses from
+// a small LRU pool) a *sql.DB against that target, runs cfg.Queries against
+// it, and serves the result as a freshly created Prometheus registry so every
+// scrape is isolated from every other target's state. This lets a single
+// sidecar monitor many DBs via Prometheus relabeling, rather than only the
+// ones the calling process itself opened through RegisterDriver.
+func ProbeHandler(cfg ProbeConfig) http.Handler {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultProbeTimeout
+	}
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = defaultProbePoolSize
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = defaultProbeIdleTimeout
+	}
+	pool := newProbePool(cfg.PoolSize, cfg.IdleTimeout, cfg.Monitor, cfg.TracerProvider)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if target == `` {
+			http.Error(w, `target parameter is missing`, http.StatusBadRequest)
+			return
+		}
+
+		db, err := pool.get(target, cfg.Backend)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.Timeout)
+		defer cancel()
+
+		reg := prometheus.NewRegistry()
+		probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: metricSubsystem,
+			Name:      "probe_success",
+			Help:      "Whether the probe of target succeeded (1) or not (0).",
+		})
+		probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: metricSubsystem,
+			Name:      "probe_duration_seconds",
+			Help:      "How long the probe of target took, in seconds.",
+		})
+		queryDuration := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: metricSubsystem,
+			Name:      "probe_query_duration_seconds",
+			Help:      "How long each probe query took, in seconds.",
+		}, []string{`query`})
+		querySuccess := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: metricSubsystem,
+			Name:      "probe_query_success",
+			Help:      "Whether each probe query succeeded (1) or not (0).",
+		}, []string{`query`})
+		reg.MustRegister(probeSuccess, probeDuration, queryDuration, querySuccess)
+
+		start := time.Now()
+		success := true
+		for _, q := range cfg.Queries {
+			qStart := time.Now()
+			rows, err := db.QueryContext(ctx, q.SQL)
+			queryDuration.WithLabelValues(q.Name).Set(time.Since(qStart).Seconds())
+			if err != nil {
+				querySuccess.WithLabelValues(q.Name).Set(0)
+				success = false
+				continue
+			}
+			rows.Close()
+			querySuccess.WithLabelValues(q.Name).Set(1)
+		}
+		probeDuration.Set(time.Since(start).Seconds())
+		if success {
+			probeSuccess.Set(1)
+		}
+
+		promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
+
+var (
+	registeredProbeDriversMu sync.Mutex
+	registeredProbeDrivers   = map[string]bool{}
+)
+
+// ensureDriverRegistered registers underlying under name the first time it's
+// called for that name, and is a no-op afterwards. It also treats name as
+// already registered if it's already present in sql.Drivers(), e.g. because
+// an earlier RegisterDriver call registered it directly via sql.Register --
+// in that case probes reuse that (possibly hooked) driver rather than
+// calling sql.Register again, which would panic ("called twice for driver").
+func ensureDriverRegistered(name string, underlying driver.Driver) {
+	registeredProbeDriversMu.Lock()
+	defer registeredProbeDriversMu.Unlock()
+	if registeredProbeDrivers[name] {
+		return
+	}
+	for _, registered := range sql.Drivers() {
+		if registered == name {
+			registeredProbeDrivers[name] = true
+			return
+		}
+	}
+	sql.Register(name, underlying)
+	registeredProbeDrivers[name] = true
+}
+
+// probePool is a small fixed-size LRU cache of *sql.DB handles keyed by
+// probe target, so repeated scrapes of the same target don't pay connection
+// setup cost, while the number of open handles stays capped at size: once
+// it's exceeded, the least recently used target's handle is closed.
+type probePool struct {
+	mu             sync.Mutex
+	size           int
+	idleTimeout    time.Duration
+	monitor        *QMonitor
+	tracerProvider trace.TracerProvider
+	order          *list.List
+	entries        map[string]*list.Element
+}
+
+type probePoolEntry struct {
+	target   string
+	db       *sql.DB
+	lastUsed time.Time
+}
+
+func newProbePool(size int, idleTimeout time.Duration, monitor *QMonitor, tracerProvider trace.TracerProvider) *probePool {
+	return &probePool{
+		size:           size,
+		idleTimeout:    idleTimeout,
+		monitor:        monitor,
+		tracerProvider: tracerProvider,
+		order:          list.New(),
+		entries:        make(map[string]*list.Element),
+	}
+}
+
+// get returns a *sql.DB for target, opening one via backendFn unless the pool
+// already holds a non-idle-expired entry for it.
+func (p *probePool) get(target string, backendFn func(string) (Backend, error)) (*sql.DB, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if el, ok := p.entries[target]; ok {
+		entry := el.Value.(*probePoolEntry)
+		if now.Sub(entry.lastUsed) < p.idleTimeout {
+			entry.lastUsed = now
+			p.order.MoveToFront(el)
+			return entry.db, nil
+		}
+		p.evictLocked(el)
+	}
+
+	backend, err := backendFn(target)
+	if err != nil {
+		return nil, fmt.Errorf("sqlm: probe backend for %q: %w", target, err)
+	}
+	ensureDriverRegistered(backend.Name(), p.wrapDriver(backend))
+
+	db, err := sql.Open(backend.Name(), backend.DSN())
+	if err != nil {
+		return nil, fmt.Errorf("sqlm: probe open %q: %w", target, err)
+	}
+
+	el := p.order.PushFront(&probePoolEntry{target: target, db: db, lastUsed: now})
+	p.entries[target] = el
+
+	for p.order.Len() > p.size {
+		p.evictLocked(p.order.Back())
+	}
+
+	return db, nil
+}
+
+// wrapDriver returns backend.Driver(), wrapped with sqlhooks bound to
+// p.monitor so probe queries also count toward its metrics, or unwrapped
+// when p.monitor is nil.
+func (p *probePool) wrapDriver(backend Backend) driver.Driver {
+	underlying := backend.Driver()
+	if p.monitor == nil {
+		return underlying
+	}
+
+	tracerProvider := p.tracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+
+	return sqlhooks.Wrap(underlying, &QHooks{
+		rw:      backend,
+		monitor: p.monitor,
+		tracer:  tracerProvider.Tracer("storage"),
+	})
+}
+
+// evictLocked removes el from the pool and closes its *sql.DB.
+// Callers must hold p.mu.
+func (p *probePool) evictLocked(el *list.Element) {
+	entry := el.Value.(*probePoolEntry)
+	delete(p.entries, entry.target)
+	p.order.Remove(el)
+	entry.db.Close()
+}
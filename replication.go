@@ -0,0 +1,308 @@
+package sqlm
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ReplicationOpts controls a replicationCollector built by NewReplicationCollector.
+type ReplicationOpts struct {
+	// CacheInterval bounds how often SHOW SLAVE STATUS / SHOW REPLICA STATUS
+	// is actually queried; repeated Collect calls within this window reuse
+	// the last result instead of hitting the primary again. Defaults to
+	// defaultReplicationCacheInterval.
+	CacheInterval time.Duration
+	// QueryTimeout bounds how long the status query may take. Defaults to
+	// defaultReplicationQueryTimeout.
+	QueryTimeout time.Duration
+	// UseReplicaSyntax selects "SHOW REPLICA STATUS" (MySQL 8.0.22+ and
+	// MariaDB's replica terminology) instead of the legacy
+	// "SHOW SLAVE STATUS". Defaults to false.
+	UseReplicaSyntax bool
+}
+
+const (
+	defaultReplicationCacheInterval = 5 * time.Second
+	defaultReplicationQueryTimeout  = 2 * time.Second
+
+	replicaPrefix = namespace + `_` + metricSubsystem + `_replica_`
+)
+
+var _ prometheus.Collector = new(replicationCollector)
+
+// replicationCollector exports replication-lag metrics, plus pool-saturation
+// gauges derived from db.Stats(), for a single *sql.DB.
+type replicationCollector struct {
+	db   *sql.DB
+	opts ReplicationOpts
+
+	mu            sync.Mutex
+	cachedAt      time.Time
+	cached        replicationStatus
+	lastWaitCount int64
+	lastWaitAt    time.Time
+
+	secondsBehindMaster *prometheus.Desc
+	ioRunning           *prometheus.Desc
+	sqlRunning          *prometheus.Desc
+	lastErrorTimestamp  *prometheus.Desc
+	poolSaturation      *prometheus.Desc
+	poolWaitRate        *prometheus.Desc
+}
+
+// NewReplicationCollector returns a prometheus.Collector that reports
+// replication lag/health for db by periodically running SHOW SLAVE STATUS
+// (or SHOW REPLICA STATUS, per opts.UseReplicaSyntax), and reports
+// pool-saturation gauges derived from db.Stats() on every Collect. db that
+// isn't a replica (the status query returns no rows) simply reports no
+// replication metrics.
+//
+// dbname disambiguates multiple replicationCollectors registered on the same
+// Registerer (e.g. one per RW/RO sql.DB, mirroring NewGoDBStatsCollector); it
+// becomes a db_name label and may be left empty when only one is registered.
+func NewReplicationCollector(dbname string, db *sql.DB, opts ReplicationOpts) prometheus.Collector {
+	if opts.CacheInterval <= 0 {
+		opts.CacheInterval = defaultReplicationCacheInterval
+	}
+	if opts.QueryTimeout <= 0 {
+		opts.QueryTimeout = defaultReplicationQueryTimeout
+	}
+
+	var l prometheus.Labels
+	if dbname != `` {
+		l = prometheus.Labels{`db_name`: dbname}
+	}
+
+	return &replicationCollector{
+		db:   db,
+		opts: opts,
+		secondsBehindMaster: prometheus.NewDesc(
+			replicaPrefix+`seconds_behind_master`,
+			`How many seconds this replica lags its source.`,
+			nil, l,
+		),
+		ioRunning: prometheus.NewDesc(
+			replicaPrefix+`io_running`,
+			`Whether the replication I/O thread is running (1) or not (0).`,
+			nil, l,
+		),
+		sqlRunning: prometheus.NewDesc(
+			replicaPrefix+`sql_running`,
+			`Whether the replication SQL thread is running (1) or not (0).`,
+			nil, l,
+		),
+		lastErrorTimestamp: prometheus.NewDesc(
+			replicaPrefix+`last_error_timestamp`,
+			`Unix timestamp of the most recent replication I/O or SQL error, or 0 if none.`,
+			nil, l,
+		),
+		poolSaturation: prometheus.NewDesc(
+			godbprefix+`pool_saturation_ratio`,
+			`The fraction of max_open_conns currently in use.`,
+			nil, l,
+		),
+		poolWaitRate: prometheus.NewDesc(
+			godbprefix+`wait_rate`,
+			`Connections waited for per second, averaged since the previous collection.`,
+			nil, l,
+		),
+	}
+}
+
+func (c *replicationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.secondsBehindMaster
+	ch <- c.ioRunning
+	ch <- c.sqlRunning
+	ch <- c.lastErrorTimestamp
+	ch <- c.poolSaturation
+	ch <- c.poolWaitRate
+}
+
+func (c *replicationCollector) Collect(ch chan<- prometheus.Metric) {
+	if st := c.status(); st.isReplica {
+		if st.hasSecondsBehind {
+			ch <- prometheus.MustNewConstMetric(c.secondsBehindMaster, prometheus.GaugeValue, st.secondsBehind)
+		}
+		ch <- prometheus.MustNewConstMetric(c.ioRunning, prometheus.GaugeValue, boolToFloat(st.ioRunning))
+		ch <- prometheus.MustNewConstMetric(c.sqlRunning, prometheus.GaugeValue, boolToFloat(st.sqlRunning))
+
+		var lastErr float64
+		if !st.lastErrorAt.IsZero() {
+			lastErr = float64(st.lastErrorAt.Unix())
+		}
+		ch <- prometheus.MustNewConstMetric(c.lastErrorTimestamp, prometheus.GaugeValue, lastErr)
+	}
+
+	stats := c.db.Stats()
+	if stats.MaxOpenConnections > 0 {
+		saturation := float64(stats.InUse) / float64(stats.MaxOpenConnections)
+		ch <- prometheus.MustNewConstMetric(c.poolSaturation, prometheus.GaugeValue, saturation)
+	}
+	ch <- prometheus.MustNewConstMetric(c.poolWaitRate, prometheus.GaugeValue, c.waitRate(stats))
+}
+
+// status returns the cached replication status, refreshing it from c.db at
+// most once per c.opts.CacheInterval so frequent scrapes don't hammer the
+// primary. On query/scan failure it logs and returns the previous value.
+func (c *replicationCollector) status() replicationStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.cachedAt) < c.opts.CacheInterval {
+		return c.cached
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.QueryTimeout)
+	defer cancel()
+
+	query := `SHOW SLAVE STATUS`
+	if c.opts.UseReplicaSyntax {
+		query = `SHOW REPLICA STATUS`
+	}
+
+	rows, err := c.db.QueryContext(ctx, query)
+	if err != nil {
+		log.Printf("sqlm: replication status query failed: %v", err)
+		return c.cached
+	}
+	defer rows.Close()
+
+	row, err := scanNamedRow(rows)
+	if err != nil {
+		log.Printf("sqlm: replication status scan failed: %v", err)
+		return c.cached
+	}
+
+	c.cached = parseReplicationStatus(row)
+	c.cachedAt = time.Now()
+	return c.cached
+}
+
+// waitRate returns connections waited for per second since the previous
+// Collect call, or 0 on the first call or a non-positive elapsed time.
+func (c *replicationCollector) waitRate(stats sql.DBStats) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	defer func() {
+		c.lastWaitCount = stats.WaitCount
+		c.lastWaitAt = now
+	}()
+
+	if c.lastWaitAt.IsZero() {
+		return 0
+	}
+	elapsed := now.Sub(c.lastWaitAt).Seconds()
+	delta := stats.WaitCount - c.lastWaitCount
+	if elapsed <= 0 || delta < 0 {
+		return 0
+	}
+	return float64(delta) / elapsed
+}
+
+// replicationStatus is the parsed subset of a SHOW SLAVE/REPLICA STATUS row
+// that NewReplicationCollector's metrics are derived from.
+type replicationStatus struct {
+	isReplica        bool
+	hasSecondsBehind bool
+	secondsBehind    float64
+	ioRunning        bool
+	sqlRunning       bool
+	lastErrorAt      time.Time
+}
+
+// scanNamedRow reads the single row SHOW SLAVE STATUS/SHOW REPLICA STATUS
+// produces into a column-name-keyed map, since the exact column set varies
+// across MySQL/MariaDB versions. It returns a nil map, not an error, when the
+// query returns no rows (the server isn't a replica).
+func scanNamedRow(rows *sql.Rows) (map[string]string, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	vals := make([]sql.RawBytes, len(cols))
+	scanArgs := make([]interface{}, len(cols))
+	for i := range vals {
+		scanArgs[i] = &vals[i]
+	}
+	if err := rows.Scan(scanArgs...); err != nil {
+		return nil, err
+	}
+
+	row := make(map[string]string, len(cols))
+	for i, col := range cols {
+		row[col] = string(vals[i])
+	}
+	return row, nil
+}
+
+// parseReplicationStatus interprets a SHOW SLAVE STATUS/SHOW REPLICA STATUS
+// row, tolerating either terminology's column names. row == nil (no
+// replication configured) yields a zero-value, non-replica status.
+func parseReplicationStatus(row map[string]string) replicationStatus {
+	if row == nil {
+		return replicationStatus{}
+	}
+
+	st := replicationStatus{isReplica: true}
+	v := row["Seconds_Behind_Master"]
+	if v == "" {
+		v = row["Seconds_Behind_Source"]
+	}
+	if v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			st.secondsBehind = f
+			st.hasSecondsBehind = true
+		}
+	}
+
+	st.ioRunning = isRunning(row["Slave_IO_Running"]) || isRunning(row["Replica_IO_Running"])
+	st.sqlRunning = isRunning(row["Slave_SQL_Running"]) || isRunning(row["Replica_SQL_Running"])
+	st.lastErrorAt = latestTimestamp(
+		row["Last_IO_Error_Timestamp"],
+		row["Last_SQL_Error_Timestamp"],
+	)
+	return st
+}
+
+func isRunning(v string) bool {
+	return strings.EqualFold(v, "Yes")
+}
+
+// latestTimestamp parses MySQL's "YYMMDD HH:MM:SS" error-timestamp format
+// and returns the latest of vals, skipping empty or unparseable entries.
+func latestTimestamp(vals ...string) time.Time {
+	var latest time.Time
+	for _, v := range vals {
+		if v == `` {
+			continue
+		}
+		t, err := time.Parse(`060102 15:04:05`, v)
+		if err != nil {
+			continue
+		}
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
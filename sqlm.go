@@ -4,164 +4,224 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
-	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
+	"log"
+	"net"
+	"strconv"
+	"sync"
 	"time"
 
-	"github.com/go-sql-driver/mysql"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/qustavo/sqlhooks/v2"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
 var (
 	_ prometheus.Collector = new(QMonitor)
 
-	defaultQMonitor = NewQMonitor()
-
-	// this regexp is used to clean-up sequences of ?,?,? in metrics dump and convert them in one ?
-	queryCleanup = regexp.MustCompile(`(,\?)+`)
-	// replace (?), blocks in insert query to empty line
-	insertQueryCleanup = regexp.MustCompile(`(?i)values \(.*$`)
-
-	defaultTracer = otel.Tracer("storage")
+	defaultQMonitor     *QMonitor
+	defaultQMonitorOnce sync.Once
 )
 
-type Key string
+// ctxKey is an unexported type for the values QHooks and its callers store in
+// a context.Context, so they can never collide with a context key defined by
+// another package.
+type ctxKey string
 
 const (
-	SqlType       = `sqlType`
-	SqlMaster     = `master`
-	SqlSlave      = `slave`
-	Begin     Key = `begin`
-	QuerySpan Key = `querySpan`
+	SqlMaster = `master`
+	SqlSlave  = `slave`
+
+	// SqlType is the context key callers use to mark a context as destined
+	// for the replica, e.g. context.WithValue(ctx, sqlm.SqlType, sqlm.SqlSlave).
+	SqlType ctxKey = `sqlType`
+
+	begin     ctxKey = `begin`
+	querySpan ctxKey = `querySpan`
 )
 
 type QHooks struct {
-	rw              *mysql.Config
-	ro              *mysql.Config
-	MaxOpenConns    int
-	MaxIdleConns    int
-	ConnMaxIdleTime time.Duration
+	rw               Backend
+	ro               Backend
+	MaxOpenConns     int
+	MaxIdleConns     int
+	ConnMaxIdleTime  time.Duration
+	SlowSQLThreshold time.Duration
+	monitor          *QMonitor
+	tracer           trace.Tracer
 }
 
 type QErrorHook struct{}
 
+// Config controls optional behaviour of RegisterDriver and the hooks it wires up.
+type Config struct {
+	// SlowSQLThreshold, when greater than zero, causes queries that take longer than this
+	// duration to be logged and counted against the query_slow_total metric.
+	SlowSQLThreshold time.Duration
+	// SlowQueryBuckets overrides the bucket boundaries used for the
+	// slowest_query_seconds histogram. Defaults to defaultSlowQueryBuckets.
+	// When Registerer is unset, this only takes effect on the first
+	// RegisterDriver call in the process, since the default QMonitor is a
+	// memoized singleton shared by every such call; see Default.
+	SlowQueryBuckets []float64
+	// Registerer, when set, is used to register this driver's QMonitor and
+	// GoDBStatsCollectors instead of the global Prometheus registry. This
+	// lets a host process that already owns a registry embed sqlm without
+	// risking a double-register panic against prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+	// TracerProvider, when set, is used to create the tracer QHooks starts
+	// spans with, instead of the global OpenTelemetry tracer provider. This
+	// lets a host process give sqlm a per-tenant tracer.
+	TracerProvider trace.TracerProvider
+}
+
 func (h *QHooks) Before(ctx context.Context, query string, args ...interface{}) (context.Context, error) {
-	var spanName = ""
-	var isSelectQuery bool = false
-	cleanQuery := queryCleanup.ReplaceAllString(query, "")
-	switch {
-	case strings.HasPrefix(strings.ToLower(query), "select"):
-		spanName = "SQL: SELECT"
-		isSelectQuery = true
-	case strings.HasPrefix(strings.ToLower(query), "update"):
-		spanName = "SQL: UPDATE"
-	case strings.HasPrefix(strings.ToLower(query), "delete"):
-		spanName = "SQL: DELETE"
-	case strings.HasPrefix(strings.ToLower(query), "create"):
-		spanName = "SQL: CREATE"
-	default:
-		spanName = "SQL: OTHER"
-		cleanQuery = insertQueryCleanup.ReplaceAllString(query, "VALUES (? ?)")
+	op, canonical := Normalize(query)
+	isSelectQuery := op == "SELECT"
+
+	ctx, span := h.tracer.Start(ctx, "SQL: "+op, trace.WithSpanKind(trace.SpanKindClient))
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemKey.String(h.getDBSystem(isSelectQuery)),
+		semconv.DBName(h.getDatabaseName(isSelectQuery)),
+		semconv.DBUser(h.getDBUserName(isSelectQuery)),
+		semconv.DBStatement(canonical),
+		semconv.DBOperation(op),
 	}
+	if addr, port := splitHostPort(h.getDBHostName(isSelectQuery)); addr != `` {
+		attrs = append(attrs, semconv.ServerAddress(addr))
+		if port != 0 {
+			attrs = append(attrs, semconv.ServerPort(port))
+		}
+	}
+	span.SetAttributes(attrs...)
 
-	ctx, span := defaultTracer.Start(ctx, spanName, trace.WithSpanKind(trace.SpanKindClient))
-	span.SetAttributes(
-		attribute.String("service.name", "mysql"),
-		attribute.String("db.host", h.getDBHostName(isSelectQuery)),
-		attribute.String("db.database", h.getDatabaseName(isSelectQuery)),
-		attribute.String("db.user", h.getDBUserName(isSelectQuery)),
-		attribute.String("query", cleanQuery),
-	)
-
-	return context.WithValue(context.WithValue(ctx, Begin, time.Now()), QuerySpan, span), nil
+	return context.WithValue(context.WithValue(ctx, begin, time.Now()), querySpan, span), nil
 }
 
 func (h *QHooks) After(ctx context.Context, query string, args ...interface{}) (context.Context, error) {
-	query = queryCleanup.ReplaceAllString(query, "")
+	op, canonical := Normalize(query)
 
 	sqlType := SqlMaster
 	if ctxSqlType := ctx.Value(SqlType); ctxSqlType != nil {
 		sqlType = ctxSqlType.(string)
 	}
 
-	if strings.HasPrefix(strings.ToLower(query), "insert") {
-		query = insertQueryCleanup.ReplaceAllString(query, "VALUES (? ?)")
-	}
-
-	begin := ctx.Value(Begin).(time.Time)
-	if querySpan := ctx.Value(QuerySpan); querySpan != nil {
-		span := querySpan.(trace.Span)
-		span.SetAttributes(attribute.String("query.time", fmt.Sprintf("%v", time.Since(begin))))
+	startedAt := ctx.Value(begin).(time.Time)
+	elapsed := time.Since(startedAt)
+	if span, ok := ctx.Value(querySpan).(trace.Span); ok {
 		span.End()
 	}
 
-	defaultQMonitor.StoreTotal(query, sqlType)
-	defaultQMonitor.StoreSuccesful(query, sqlType)
-	defaultQMonitor.StoreLatency(query, time.Since(begin), sqlType)
+	h.monitor.StoreTotal(canonical, sqlType)
+	h.monitor.StoreSuccesful(canonical, sqlType)
+	h.monitor.StoreLatency(canonical, elapsed, sqlType)
+	h.reportSlowQuery(canonical, sqlType, elapsed, len(args), op == "SELECT")
 	return ctx, nil
 }
 
 func (h *QHooks) OnError(ctx context.Context, err error, query string, args ...interface{}) error {
-	query = queryCleanup.ReplaceAllString(query, "")
 	if err == driver.ErrSkip || err == nil {
 		return nil
 	}
+	op, canonical := Normalize(query)
 
 	sqlType := SqlMaster
-	if ctxSqlType := ctx.Value(sqlType); ctxSqlType != nil {
+	if ctxSqlType := ctx.Value(SqlType); ctxSqlType != nil {
 		sqlType = ctxSqlType.(string)
 	}
 
-	defaultQMonitor.StoreTotal(query, sqlType)
-	defaultQMonitor.StoreErroneous(query, sqlType)
-	begin := ctx.Value(Begin).(time.Time)
-	defaultQMonitor.StoreLatency(query, time.Since(begin), sqlType)
-
-	if querySpan := ctx.Value(QuerySpan); querySpan != nil {
-		span := querySpan.(trace.Span)
-		span.SetAttributes(
-			attribute.Bool("error", true),
-			attribute.String("errorText", err.Error()),
-		)
+	h.monitor.StoreTotal(canonical, sqlType)
+	h.monitor.StoreErroneous(canonical, sqlType)
+	startedAt := ctx.Value(begin).(time.Time)
+	elapsed := time.Since(startedAt)
+	h.monitor.StoreLatency(canonical, elapsed, sqlType)
+	h.reportSlowQuery(canonical, sqlType, elapsed, len(args), op == "SELECT")
+
+	if span, ok := ctx.Value(querySpan).(trace.Span); ok {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		span.End()
 	}
 
 	return err
 }
+
+// reportSlowQuery logs and counts query if it ran longer than h.SlowSQLThreshold.
+// It is a no-op when no threshold has been configured.
+func (h *QHooks) reportSlowQuery(canonicalQuery string, sqlType string, elapsed time.Duration, argsCount int, isSelectQuery bool) {
+	if h.SlowSQLThreshold <= 0 || elapsed <= h.SlowSQLThreshold {
+		return
+	}
+
+	log.Printf(
+		"slow query detected: query=%q args=%d latency=%s sqlType=%s host=%s",
+		canonicalQuery, argsCount, elapsed, sqlType, h.getDBHostName(isSelectQuery),
+	)
+	h.monitor.StoreSlow(canonicalQuery, sqlType)
+	h.monitor.StoreSlowLatency(canonicalQuery, elapsed, sqlType)
+}
+
 func (h *QHooks) getDBHostName(isSelectQuery bool) (host string) {
-	host = h.rw.Addr
-	if isSelectQuery && h.ro.Addr != `` {
-		host = h.ro.Addr
+	host = h.rw.HostInfo()
+	if isSelectQuery && h.ro != nil && h.ro.HostInfo() != `` {
+		host = h.ro.HostInfo()
 	}
 	return host
 }
 
 func (h *QHooks) getDatabaseName(isSelectQuery bool) (name string) {
-	name = h.rw.DBName
-	if isSelectQuery && h.ro.DBName != `` {
-		name = h.ro.DBName
+	name = h.rw.DBInfo()
+	if isSelectQuery && h.ro != nil && h.ro.DBInfo() != `` {
+		name = h.ro.DBInfo()
 	}
 	return name
 }
 
 func (h *QHooks) getDBUserName(isSelectQuery bool) (user string) {
-	user = h.rw.User
-	if isSelectQuery && h.ro.User != `` {
-		user = h.ro.User
+	user = h.rw.UserInfo()
+	if isSelectQuery && h.ro != nil && h.ro.UserInfo() != `` {
+		user = h.ro.UserInfo()
 	}
 	return user
 }
-func init() {
-	prometheus.MustRegister(defaultQMonitor)
+
+func (h *QHooks) getDBSystem(isSelectQuery bool) (system string) {
+	system = h.rw.DBSystem()
+	if isSelectQuery && h.ro != nil && h.ro.DBSystem() != `` {
+		system = h.ro.DBSystem()
+	}
+	return system
 }
 
-func DefaultQMonitor() *QMonitor {
+// splitHostPort splits a "host:port" string, as returned by Backend.HostInfo,
+// into its server.address/server.port semantic-convention parts. port
+// is 0 when hostport has no port, or its port isn't numeric.
+func splitHostPort(hostport string) (addr string, port int) {
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return hostport, 0
+	}
+	port, err = strconv.Atoi(portStr)
+	if err != nil {
+		return host, 0
+	}
+	return host, port
+}
+
+// Default returns the package-level QMonitor, building and registering it
+// with prometheus.DefaultRegisterer the first time it's called. This
+// preserves sqlm's original behavior for callers that pass a zero-value
+// Config (no Registerer) to RegisterDriver. slowQueryBuckets is only honored
+// on the very first call across the process, since the QMonitor it builds is
+// memoized; later calls (and later, differing bucket sets) reuse it as-is.
+func Default(slowQueryBuckets ...float64) *QMonitor {
+	defaultQMonitorOnce.Do(func() {
+		defaultQMonitor = NewQMonitor(slowQueryBuckets...)
+		prometheus.MustRegister(defaultQMonitor)
+	})
 	return defaultQMonitor
 }
 
@@ -170,11 +230,26 @@ type QMonitor struct {
 	success *prometheus.CounterVec
 	errors  *prometheus.CounterVec
 	latency *prometheus.HistogramVec
+	slow    *prometheus.CounterVec
+	slowest *prometheus.HistogramVec
 }
 
-func NewQMonitor() *QMonitor {
+// defaultSlowQueryBuckets mirrors Prometheus' RED conventions for a latency
+// histogram: exponential buckets spanning 1ms through roughly 10s.
+func defaultSlowQueryBuckets() []float64 {
+	return prometheus.ExponentialBucketsRange(0.001, 10, 14)
+}
+
+// NewQMonitor builds a QMonitor. slowQueryBuckets overrides the bucket
+// boundaries used for the slowest_query_seconds histogram; when omitted it
+// falls back to defaultSlowQueryBuckets.
+func NewQMonitor(slowQueryBuckets ...float64) *QMonitor {
 	labels := []string{`query`, `type`}
 
+	if len(slowQueryBuckets) == 0 {
+		slowQueryBuckets = defaultSlowQueryBuckets()
+	}
+
 	return &QMonitor{
 		total: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Namespace: namespace,
@@ -200,14 +275,29 @@ func NewQMonitor() *QMonitor {
 			Name:      "query_latency",
 			Help:      "The latency of query execution.",
 		}, labels),
+		slow: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: metricSubsystem,
+			Name:      "query_slow_total",
+			Help:      "The total number of queries that exceeded the configured slow-query threshold.",
+		}, labels),
+		slowest: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: metricSubsystem,
+			Name:      "slowest_query_seconds",
+			Help:      "The latency distribution of queries that exceeded the configured slow-query threshold.",
+			Buckets:   slowQueryBuckets,
+		}, labels),
 	}
 }
 
+// SanitizeQuery returns the canonical form of query, as produced by Normalize.
+// Kept for callers that sanitize a query directly rather than going through
+// QHooks; QHooks itself passes already-canonical queries to the Store*
+// methods below, so this is idempotent on their input.
 func SanitizeQuery(query string) string {
-	var res string
-	re := regexp.MustCompile(`(\d(,?))+`)
-	res = re.ReplaceAllString(query, "")
-	return res
+	_, canonical := Normalize(query)
+	return canonical
 }
 
 func (mon *QMonitor) StoreTotal(name string, sqlType string) {
@@ -226,11 +316,21 @@ func (mon *QMonitor) StoreLatency(name string, d time.Duration, sqlType string)
 	mon.latency.WithLabelValues(SanitizeQuery(name), sqlType).Observe(d.Seconds())
 }
 
+func (mon *QMonitor) StoreSlow(name string, sqlType string) {
+	mon.slow.WithLabelValues(SanitizeQuery(name), sqlType).Inc()
+}
+
+func (mon *QMonitor) StoreSlowLatency(name string, d time.Duration, sqlType string) {
+	mon.slowest.WithLabelValues(SanitizeQuery(name), sqlType).Observe(d.Seconds())
+}
+
 func (mon *QMonitor) Describe(ch chan<- *prometheus.Desc) {
 	mon.total.Describe(ch)
 	mon.success.Describe(ch)
 	mon.errors.Describe(ch)
 	mon.latency.Describe(ch)
+	mon.slow.Describe(ch)
+	mon.slowest.Describe(ch)
 }
 
 func (mon *QMonitor) Collect(ch chan<- prometheus.Metric) {
@@ -238,39 +338,92 @@ func (mon *QMonitor) Collect(ch chan<- prometheus.Metric) {
 	mon.success.Collect(ch)
 	mon.errors.Collect(ch)
 	mon.latency.Collect(ch)
+	mon.slow.Collect(ch)
+	mon.slowest.Collect(ch)
 }
 
-func RegisterDriver(rw *mysql.Config, ro *mysql.Config, maxOpenConns int, maxIdleConns int, connMaxIdleTime time.Duration) (dbRW *sql.DB, dbRO *sql.DB, err error) {
-	mysqlhook := QHooks{rw: rw, ro: ro}
-	sql.Register("mysqlm", sqlhooks.Wrap(&mysql.MySQLDriver{}, &mysqlhook))
+// RegisterDriver wraps rw (and, optionally, ro) with sqlhooks-based
+// instrumentation and opens *sql.DBs against them. rw and ro must come from
+// the same Backend implementation (e.g. both MySQLBackend) since they share a
+// single registered driver name and QHooks instance.
+func RegisterDriver(rw Backend, ro Backend, maxOpenConns int, maxIdleConns int, connMaxIdleTime time.Duration, cfg Config) (dbRW *sql.DB, dbRO *sql.DB, err error) {
+	registerer := cfg.Registerer
+	var monitor *QMonitor
+	if registerer != nil {
+		monitor = NewQMonitor(cfg.SlowQueryBuckets...)
+		if err = registerer.Register(monitor); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		monitor = Default(cfg.SlowQueryBuckets...)
+		registerer = prometheus.DefaultRegisterer
+	}
+
+	tracerProvider := cfg.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+
+	hooks := QHooks{
+		rw:               rw,
+		ro:               ro,
+		SlowSQLThreshold: cfg.SlowSQLThreshold,
+		monitor:          monitor,
+		tracer:           tracerProvider.Tracer("storage"),
+	}
+
+	driverName := backendDriverName(rw, ro)
+	if underlying := backendDriver(rw, ro); underlying != nil {
+		sql.Register(driverName, sqlhooks.Wrap(underlying, &hooks))
+	}
 
 	if rw != nil {
-		rwDsn := rw.FormatDSN()
-		dbRW, err = sql.Open(`mysqlm`, rwDsn+fmt.Sprintf("&parseTime=True&loc=%s&time_zone=%s", time.Local.String(), url.QueryEscape("'+00:00'")))
+		dbRW, err = sql.Open(driverName, rw.DSN())
 		if err == nil {
 			dbRW.SetMaxOpenConns(maxOpenConns)
 			dbRW.SetMaxIdleConns(maxIdleConns)
 			dbRW.SetConnMaxIdleTime(connMaxIdleTime)
 			//Registrer RW Database stats
-			err = prometheus.Register(NewGoDBStatsCollector(rw.DBName+`-rw`, dbRW))
+			err = registerer.Register(NewGoDBStatsCollector(rw.DBInfo()+`-rw`, dbRW))
 		}
 	}
 
 	if ro != nil {
-		roDsn := ro.FormatDSN()
-		dbRO, err = sql.Open(`mysqlm`, roDsn+fmt.Sprintf("&parseTime=True&loc=%s&time_zone=%s", time.Local.String(), url.QueryEscape("'+00:00'")))
+		dbRO, err = sql.Open(driverName, ro.DSN())
 		if err == nil {
 			dbRO.SetMaxOpenConns(maxOpenConns)
 			dbRO.SetMaxIdleConns(maxIdleConns)
 			dbRO.SetConnMaxIdleTime(connMaxIdleTime)
 			//Registrer RO Database stats
-			err = prometheus.Register(NewGoDBStatsCollector(ro.DBName+`-ro`, dbRO))
+			err = registerer.Register(NewGoDBStatsCollector(ro.DBInfo()+`-ro`, dbRO))
 		}
 	}
 
 	return dbRW, dbRO, err
 }
 
+// backendDriverName picks the driver name to register rw/ro under, preferring rw.
+func backendDriverName(rw Backend, ro Backend) string {
+	if rw != nil {
+		return rw.Name()
+	}
+	if ro != nil {
+		return ro.Name()
+	}
+	return ``
+}
+
+// backendDriver picks the underlying driver.Driver to wrap with hooks, preferring rw.
+func backendDriver(rw Backend, ro Backend) driver.Driver {
+	if rw != nil {
+		return rw.Driver()
+	}
+	if ro != nil {
+		return ro.Driver()
+	}
+	return nil
+}
+
 const (
 	namespace       = `dx`
 	metricSubsystem = `sqlm`